@@ -0,0 +1,69 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command bebop converts rpcreplay recordings between the binary format
+// and the human-readable JSON transcript format.
+//
+// Usage:
+//
+//	bebop convert -json <in> <out>   // binary recording -> JSON transcript
+//	bebop convert <in> <out>         // JSON transcript -> binary recording
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/internal/rpcreplay"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "convert" {
+		usage()
+	}
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	toJSON := fs.Bool("json", false, "convert a binary recording to a JSON transcript (default: JSON transcript to binary)")
+	fs.Parse(os.Args[2:])
+	args := fs.Args()
+	if len(args) != 2 {
+		usage()
+	}
+	if err := convert(args[0], args[1], *toJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "bebop convert:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bebop convert [-json] <in> <out>")
+	os.Exit(2)
+}
+
+func convert(in, out string, toJSON bool) error {
+	inf, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer inf.Close()
+	outf, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer outf.Close()
+	if toJSON {
+		return rpcreplay.ConvertToJSON(inf, outf)
+	}
+	return rpcreplay.ConvertToBinary(inf, outf)
+}
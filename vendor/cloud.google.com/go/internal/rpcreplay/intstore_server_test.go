@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcreplay
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	ipb "cloud.google.com/go/internal/rpcreplay/proto/intstore"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// intStoreServer is a trivial in-memory implementation of the IntStore
+// service, used only so the tests in this package have something real to
+// record and replay calls against.
+type intStoreServer struct {
+	Addr string
+
+	srv  *grpc.Server
+	mu   sync.Mutex
+	vals map[string]int32
+}
+
+func newIntStoreServer() *intStoreServer {
+	s := &intStoreServer{vals: map[string]int32{}}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		panic(fmt.Sprintf("rpcreplay: could not listen: %v", err))
+	}
+	s.Addr = lis.Addr().String()
+	s.srv = grpc.NewServer()
+	ipb.RegisterIntStoreServer(s.srv, s)
+	go s.srv.Serve(lis)
+	return s
+}
+
+func (s *intStoreServer) stop() {
+	s.srv.Stop()
+}
+
+func (s *intStoreServer) Set(ctx context.Context, item *ipb.Item) (*ipb.SetResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.vals[item.Name]
+	s.vals[item.Name] = item.Value
+	return &ipb.SetResponse{PrevValue: prev}, nil
+}
+
+func (s *intStoreServer) Get(ctx context.Context, req *ipb.GetRequest) (*ipb.Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.vals[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%q", req.Name)
+	}
+	return &ipb.Item{Name: req.Name, Value: v}, nil
+}
+
+func (s *intStoreServer) ListItems(_ *ipb.ListItemsRequest, stream ipb.IntStore_ListItemsServer) error {
+	s.mu.Lock()
+	items := make([]*ipb.Item, 0, len(s.vals))
+	for name, v := range s.vals {
+		items = append(items, &ipb.Item{Name: name, Value: v})
+	}
+	s.mu.Unlock()
+	for _, item := range items {
+		if err := stream.Send(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *intStoreServer) SetStream(stream ipb.IntStore_SetStreamServer) error {
+	var n int32
+	for {
+		item, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&ipb.SetStreamResponse{NumSet: n})
+		}
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.vals[item.Name] = item.Value
+		s.mu.Unlock()
+		n++
+	}
+}
+
+// Sync sets each Item it receives and immediately streams back an Item
+// holding the value that key previously had. A negative value ends the
+// stream with InvalidArgument, so tests can exercise a mid-stream error.
+func (s *intStoreServer) Sync(stream ipb.IntStore_SyncServer) error {
+	for {
+		item, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if item.Value < 0 {
+			return status.Errorf(codes.InvalidArgument, "negative value for %q", item.Name)
+		}
+		s.mu.Lock()
+		prev := s.vals[item.Name]
+		s.vals[item.Name] = item.Value
+		s.mu.Unlock()
+		if err := stream.Send(&ipb.Item{Name: item.Name, Value: prev}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcreplay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	rpb "cloud.google.com/go/internal/rpcreplay/proto/rpcreplay"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fileHeaderJSON is the first line of a JSON transcript file, in place of
+// fileHeader for the binary format.
+const fileHeaderJSON = "gRPCReplayJSON\n"
+
+// jsonHeader is the second line of a JSON transcript file: the initial
+// state passed to NewRecorderWriterJSON, base64-encoded by encoding/json's
+// default []byte handling.
+type jsonHeader struct {
+	Initial []byte `json:"initial"`
+}
+
+// jsonEntry is the newline-delimited JSON encoding of an entry. Each line
+// of a JSON transcript unmarshals into one of these.
+type jsonEntry struct {
+	Kind            string              `json:"kind"`
+	Method          string              `json:"method,omitempty"`
+	Ref             int                 `json:"ref,omitempty"`
+	StreamID        int                 `json:"stream_id,omitempty"`
+	Type            string              `json:"type,omitempty"`
+	Message         json.RawMessage     `json:"message,omitempty"`
+	Error           *jsonStatus         `json:"error,omitempty"`
+	EOF             bool                `json:"eof,omitempty"`
+	RequestMetadata map[string][]string `json:"request_metadata,omitempty"`
+	ResponseHeader  map[string][]string `json:"response_header,omitempty"`
+	ResponseTrailer map[string][]string `json:"response_trailer,omitempty"`
+	Deadline        string              `json:"deadline,omitempty"`
+}
+
+// jsonStatus is the JSON rendering of a gRPC status error, using the
+// canonical SCREAMING_SNAKE_CASE names from google.rpc.Code.
+type jsonStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var codeNames = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+var namesToCode = func() map[string]codes.Code {
+	m := make(map[string]codes.Code, len(codeNames))
+	for c, n := range codeNames {
+		m[n] = c
+	}
+	return m
+}()
+
+func codeName(c codes.Code) string {
+	if n, ok := codeNames[c]; ok {
+		return n
+	}
+	return c.String()
+}
+
+func codeFromName(n string) codes.Code {
+	if c, ok := namesToCode[n]; ok {
+		return c
+	}
+	return codes.Unknown
+}
+
+// writeHeaderJSON writes the JSON transcript file header and the initial
+// state to w.
+func writeHeaderJSON(w io.Writer, initial []byte) error {
+	if _, err := io.WriteString(w, fileHeaderJSON); err != nil {
+		return err
+	}
+	return writeJSONLine(w, &jsonHeader{Initial: initial})
+}
+
+// readHeaderJSON reads the initial state from a JSON transcript, assuming
+// the fileHeaderJSON magic has already been consumed from br.
+func readHeaderJSON(br *bufio.Reader) ([]byte, error) {
+	var h jsonHeader
+	if err := readJSONLine(br, &h); err != nil {
+		return nil, err
+	}
+	return h.Initial, nil
+}
+
+func writeJSONLine(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
+
+func readJSONLine(br *bufio.Reader, v interface{}) error {
+	line, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(line) == 0 {
+		return io.EOF
+	}
+	return json.Unmarshal(line, v)
+}
+
+// writeEntryJSON writes e to w as one line of a JSON transcript.
+func writeEntryJSON(w io.Writer, e *entry) error {
+	je := &jsonEntry{
+		Kind:     e.kind.String(),
+		Method:   e.method,
+		Ref:      e.refIndex,
+		StreamID: e.streamID,
+	}
+	if len(e.reqMD) > 0 {
+		je.RequestMetadata = map[string][]string(e.reqMD)
+	}
+	if len(e.header) > 0 {
+		je.ResponseHeader = map[string][]string(e.header)
+	}
+	if len(e.trailer) > 0 {
+		je.ResponseTrailer = map[string][]string(e.trailer)
+	}
+	if e.hasDeadline {
+		je.Deadline = e.timeout.String()
+	}
+	switch {
+	case e.msg.err == io.EOF:
+		je.EOF = true
+	case e.msg.err != nil:
+		s, _ := status.FromError(e.msg.err)
+		je.Error = &jsonStatus{Code: codeName(s.Code()), Message: s.Message()}
+	case e.msg.msg != nil:
+		je.Type = proto.MessageName(e.msg.msg)
+		m := jsonpb.Marshaler{}
+		var buf bytes.Buffer
+		if err := m.Marshal(&buf, e.msg.msg); err != nil {
+			return err
+		}
+		je.Message = buf.Bytes()
+	}
+	return writeJSONLine(w, je)
+}
+
+// readEntryJSON reads one line of a JSON transcript from br, returning
+// (nil, nil) at a clean end of stream.
+func readEntryJSON(br *bufio.Reader) (*entry, error) {
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF && len(line) == 0 {
+			return nil, nil
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+	}
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil, nil
+	}
+	var je jsonEntry
+	if err := json.Unmarshal(line, &je); err != nil {
+		return nil, err
+	}
+	kind, ok := rpb.Entry_Kind_value[je.Kind]
+	if !ok {
+		return nil, fmt.Errorf("rpcreplay: unknown entry kind %q", je.Kind)
+	}
+	e := &entry{
+		kind:     rpb.Entry_Kind(kind),
+		method:   je.Method,
+		refIndex: je.Ref,
+		streamID: je.StreamID,
+	}
+	if len(je.RequestMetadata) > 0 {
+		e.reqMD = metadata.MD(je.RequestMetadata)
+	}
+	if len(je.ResponseHeader) > 0 {
+		e.header = metadata.MD(je.ResponseHeader)
+	}
+	if len(je.ResponseTrailer) > 0 {
+		e.trailer = metadata.MD(je.ResponseTrailer)
+	}
+	if je.Deadline != "" {
+		d, err := time.ParseDuration(je.Deadline)
+		if err != nil {
+			return nil, fmt.Errorf("rpcreplay: bad deadline %q: %v", je.Deadline, err)
+		}
+		e.hasDeadline = true
+		e.timeout = d
+	}
+	switch {
+	case je.EOF:
+		e.msg = message{err: io.EOF}
+	case je.Error != nil:
+		e.msg = message{err: status.Error(codeFromName(je.Error.Code), je.Error.Message)}
+	case je.Message != nil:
+		typ := proto.MessageType(je.Type)
+		if typ == nil {
+			return nil, fmt.Errorf("rpcreplay: unknown message type %q", je.Type)
+		}
+		msg := reflect.New(typ.Elem()).Interface().(proto.Message)
+		if err := jsonpb.Unmarshal(bytes.NewReader(je.Message), msg); err != nil {
+			return nil, err
+		}
+		e.msg = message{msg: msg}
+	}
+	return e, nil
+}
+
+// ConvertToJSON reads a recording in the binary format from r and writes
+// the equivalent human-readable JSON transcript to w.
+func ConvertToJSON(r io.Reader, w io.Writer) error {
+	return convertFormat(r, w, true)
+}
+
+// ConvertToBinary reads a JSON transcript, as written by
+// NewRecorderWriterJSON or ConvertToJSON, from r and writes the
+// equivalent recording in the binary format to w.
+func ConvertToBinary(r io.Reader, w io.Writer) error {
+	return convertFormat(r, w, false)
+}
+
+func convertFormat(r io.Reader, w io.Writer, toJSON bool) error {
+	br := bufio.NewReader(r)
+	initial, isJSON, err := detectAndReadHeader(br)
+	if err != nil {
+		return err
+	}
+	if isJSON == toJSON {
+		return fmt.Errorf("rpcreplay: input is already in the requested format")
+	}
+	if toJSON {
+		err = writeHeaderJSON(w, initial)
+	} else {
+		err = writeHeader(w, initial)
+	}
+	if err != nil {
+		return err
+	}
+	for {
+		var e *entry
+		if isJSON {
+			e, err = readEntryJSON(br)
+		} else {
+			e, err = readEntry(br)
+		}
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return nil
+		}
+		if toJSON {
+			err = writeEntryJSON(w, e)
+		} else {
+			err = writeEntry(w, e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// detectAndReadHeader reads the file header from br, which may be in
+// either the binary or the JSON transcript format, and reports which one
+// it found.
+func detectAndReadHeader(br *bufio.Reader) (initial []byte, isJSON bool, err error) {
+	prefix, peekErr := br.Peek(len(fileHeaderJSON))
+	if peekErr == nil && string(prefix) == fileHeaderJSON {
+		if _, err := br.Discard(len(fileHeaderJSON)); err != nil {
+			return nil, false, err
+		}
+		initial, err = readHeaderJSON(br)
+		return initial, true, err
+	}
+	initial, err = readHeader(br)
+	return initial, false, err
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcreplay
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// A Matcher reports whether got, the message passed to a live RPC, should
+// be considered a match for want, the corresponding message previously
+// recorded for the same method. The default, used when no Matcher is set
+// on a Replayer, is proto.Equal.
+type Matcher func(method string, got, want proto.Message) bool
+
+// A Scrubber returns a copy of msg with non-deterministic parts (such as
+// timestamps, UUIDs or auth tokens) normalized or removed. Scrubbers must
+// not modify msg itself.
+type Scrubber func(method string, msg proto.Message) proto.Message
+
+// ClearFields returns a Scrubber that zeroes the named fields of a message
+// before it is recorded or matched. Each name is a dot-separated path of
+// exported Go struct field names, for example "RequestId" or
+// "Metadata.RequestId", allowing nested messages to be reached.
+func ClearFields(paths ...string) Scrubber {
+	return func(_ string, msg proto.Message) proto.Message {
+		clone := proto.Clone(msg)
+		for _, p := range paths {
+			clearField(reflect.ValueOf(clone), strings.Split(p, "."))
+		}
+		return clone
+	}
+}
+
+func clearField(v reflect.Value, path []string) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	f := v.FieldByName(path[0])
+	if !f.IsValid() || !f.CanSet() {
+		return
+	}
+	if len(path) == 1 {
+		f.Set(reflect.Zero(f.Type()))
+		return
+	}
+	clearField(f, path[1:])
+}
+
+// RoundTimestamps returns a Scrubber that rounds every *timestamp.Timestamp
+// field named in paths (see ClearFields for the path syntax) down to the
+// nearest multiple of bucket, so that recordings stay stable across runs
+// that each generate their own "now".
+func RoundTimestamps(bucket time.Duration, paths ...string) Scrubber {
+	return func(_ string, msg proto.Message) proto.Message {
+		clone := proto.Clone(msg)
+		for _, p := range paths {
+			roundTimestampField(reflect.ValueOf(clone), strings.Split(p, "."), bucket)
+		}
+		return clone
+	}
+}
+
+func roundTimestampField(v reflect.Value, path []string, bucket time.Duration) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	f := v.FieldByName(path[0])
+	if !f.IsValid() {
+		return
+	}
+	if len(path) > 1 {
+		roundTimestampField(f, path[1:], bucket)
+		return
+	}
+	ts, ok := f.Interface().(*timestamp.Timestamp)
+	if !ok {
+		return
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return
+	}
+	rounded := t.Truncate(bucket)
+	rts, err := ptypes.TimestampProto(rounded)
+	if err != nil || !f.CanSet() {
+		return
+	}
+	f.Set(reflect.ValueOf(rts))
+}
+
+// FuzzyMatcher returns a Matcher that treats zero-valued (unset) fields of
+// the recorded message as wildcards: a live field matching such a field is
+// always accepted, regardless of its value. Fields that were set when
+// recorded must still be equal.
+func FuzzyMatcher() Matcher {
+	return func(_ string, got, want proto.Message) bool {
+		return fuzzyEqual(reflect.ValueOf(got), reflect.ValueOf(want))
+	}
+}
+
+func fuzzyEqual(got, want reflect.Value) bool {
+	if !got.IsValid() || !want.IsValid() {
+		return got.IsValid() == want.IsValid()
+	}
+	if want.Kind() == reflect.Ptr {
+		if want.IsNil() {
+			return true // wildcard: the recorded side didn't set this message
+		}
+		if got.Kind() != reflect.Ptr || got.IsNil() {
+			return false
+		}
+		return fuzzyEqual(got.Elem(), want.Elem())
+	}
+	if want.Kind() != reflect.Struct {
+		if isZeroValue(want) {
+			return true // wildcard: the recorded side left this scalar unset
+		}
+		return reflect.DeepEqual(got.Interface(), want.Interface())
+	}
+	for i := 0; i < want.NumField(); i++ {
+		name := want.Type().Field(i).Name
+		if strings.HasPrefix(name, "XXX_") {
+			continue
+		}
+		if !fuzzyEqual(got.FieldByName(name), want.Field(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeroValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
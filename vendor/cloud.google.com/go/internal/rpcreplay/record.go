@@ -0,0 +1,335 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcreplay
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	rpb "cloud.google.com/go/internal/rpcreplay/proto/rpcreplay"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// A Recorder records RPCs for later playback.
+type Recorder struct {
+	headerFilter
+
+	mu              sync.Mutex
+	w               io.Writer
+	f               *os.File
+	next            int // entry index, 1-based, of the next entry to write
+	nextStream      int // stream id, 1-based, of the next stream to open
+	err             error
+	json            bool // write the human-readable JSON transcript format
+	reqScrubbers    []Scrubber
+	respScrubbers   []Scrubber
+	keepaliveParams *keepalive.ClientParameters
+}
+
+// NewRecorder creates a recorder that writes to filename. The file will
+// also hold the initial bytes, so they can be retrieved during replay.
+//
+// You must call Close on the Recorder to ensure that all data is written.
+func NewRecorder(filename string, initial []byte) (*Recorder, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := NewRecorderWriter(f, initial)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	rec.f = f
+	return rec, nil
+}
+
+// NewRecorderWriter creates a recorder that writes to w. NewRecorderWriter
+// is for advanced use; most users should call NewRecorder.
+func NewRecorderWriter(w io.Writer, initial []byte) (*Recorder, error) {
+	if err := writeHeader(w, initial); err != nil {
+		return nil, err
+	}
+	return &Recorder{w: w}, nil
+}
+
+// NewRecorderWriterJSON creates a recorder that writes a human-readable,
+// newline-delimited JSON transcript to w instead of the default binary
+// format. The result is diffable in code review and can be hand-edited to
+// build test fixtures, at the cost of a larger file.
+func NewRecorderWriterJSON(w io.Writer, initial []byte) (*Recorder, error) {
+	if err := writeHeaderJSON(w, initial); err != nil {
+		return nil, err
+	}
+	return &Recorder{w: w, json: true}, nil
+}
+
+// RedactHeaders marks the given (case-insensitive) outgoing metadata and
+// response header/trailer keys to have their values replaced with a fixed
+// placeholder in the recording. Use this for keys, such as "authorization",
+// whose values must not end up in a file that may be committed to version
+// control.
+func (r *Recorder) RedactHeaders(keys ...string) { r.redactHeaders(keys...) }
+
+// IgnoreHeaders marks the given (case-insensitive) outgoing metadata and
+// response header/trailer keys to be dropped entirely rather than
+// recorded.
+func (r *Recorder) IgnoreHeaders(keys ...string) { r.ignoreHeaders(keys...) }
+
+// AddRequestScrubber registers a Scrubber that is applied to every
+// outgoing request message before it is written to the recording, so the
+// file on disk is deterministic across runs.
+func (r *Recorder) AddRequestScrubber(s Scrubber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reqScrubbers = append(r.reqScrubbers, s)
+}
+
+// AddResponseScrubber registers a Scrubber that is applied to every
+// response message before it is written to the recording.
+func (r *Recorder) AddResponseScrubber(s Scrubber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.respScrubbers = append(r.respScrubbers, s)
+}
+
+func (r *Recorder) scrub(method string, msg proto.Message, scrubbers []Scrubber) proto.Message {
+	r.mu.Lock()
+	ss := scrubbers
+	r.mu.Unlock()
+	for _, s := range ss {
+		msg = s(method, msg)
+	}
+	return msg
+}
+
+// SetKeepaliveParams sets the keepalive parameters that DialOptions will
+// pass to grpc.Dial, so the recording connection can be tuned to match the
+// production dial options used for long-lived streaming calls.
+func (r *Recorder) SetKeepaliveParams(kp keepalive.ClientParameters) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keepaliveParams = &kp
+}
+
+// DialOptions returns the options that must be passed to grpc.Dial to enable
+// recording.
+func (r *Recorder) DialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(r.interceptUnary),
+		grpc.WithStreamInterceptor(r.interceptStream),
+	}
+	if r.keepaliveParams != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*r.keepaliveParams))
+	}
+	return opts
+}
+
+// Close saves any unwritten information.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		return r.f.Close()
+	}
+	return nil
+}
+
+func (r *Recorder) interceptUnary(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	outMD, _ := metadata.FromOutgoingContext(ctx)
+	hasDeadline, timeout := contextTimeout(ctx)
+	refIndex, err := r.writeEntry(&entry{
+		kind:        rpb.Entry_REQUEST,
+		method:      method,
+		msg:         message{msg: r.scrub(method, req.(proto.Message), r.reqScrubbers)},
+		reqMD:       r.apply(outMD),
+		hasDeadline: hasDeadline,
+		timeout:     timeout,
+	})
+	if err != nil {
+		return r.setErr(err)
+	}
+	var header, trailer metadata.MD
+	opts = append(opts, grpc.Header(&header), grpc.Trailer(&trailer))
+	ierr := invoker(ctx, method, req, res, cc, opts...)
+	var respMsg message
+	if ierr != nil {
+		respMsg = message{err: ierr}
+	} else {
+		respMsg = message{msg: r.scrub(method, res.(proto.Message), r.respScrubbers)}
+	}
+	_, err = r.writeEntry(&entry{
+		kind:     rpb.Entry_RESPONSE,
+		msg:      respMsg,
+		refIndex: refIndex,
+		header:   r.apply(header),
+		trailer:  r.apply(trailer),
+	})
+	if err != nil {
+		return r.setErr(err)
+	}
+	return ierr
+}
+
+func (r *Recorder) interceptStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	outMD, _ := metadata.FromOutgoingContext(ctx)
+	hasDeadline, timeout := contextTimeout(ctx)
+	streamID := r.newStreamID()
+	_, err := r.writeEntry(&entry{
+		kind:        rpb.Entry_REQUEST,
+		method:      method,
+		reqMD:       r.apply(outMD),
+		streamID:    streamID,
+		hasDeadline: hasDeadline,
+		timeout:     timeout,
+	})
+	if err != nil {
+		return nil, r.setErr(err)
+	}
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &recClientStream{ClientStream: s, r: r, method: method, streamID: streamID, recordSends: desc.ClientStreams}, nil
+}
+
+// newStreamID returns a fresh id, unique within r, identifying a streaming
+// call, so its SEND and RECV entries can be grouped and replayed in
+// isolation from any other concurrent stream.
+func (r *Recorder) newStreamID() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextStream++
+	return r.nextStream
+}
+
+// recClientStream wraps a grpc.ClientStream, recording every message sent
+// to or received from the server, in the order the calls actually happen,
+// as SEND and RECV entries tagged with the stream's id.
+type recClientStream struct {
+	grpc.ClientStream
+	r        *Recorder
+	method   string
+	streamID int
+
+	// recordSends is desc.ClientStreams: true for client- and bidi-
+	// streaming calls, false for a server-streaming call. Server-streaming
+	// stubs issue their single request via an implicit SendMsg/CloseSend
+	// on the client stream rather than a call the user makes, so those
+	// must not be recorded as SEND entries.
+	recordSends bool
+}
+
+func (s *recClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if !s.recordSends {
+		return err
+	}
+	var msg message
+	if err != nil {
+		msg = message{err: err}
+	} else {
+		msg = message{msg: s.r.scrub(s.method, m.(proto.Message), s.r.reqScrubbers)}
+	}
+	_, werr := s.r.writeEntry(&entry{
+		kind:     rpb.Entry_SEND,
+		method:   s.method,
+		msg:      msg,
+		streamID: s.streamID,
+	})
+	if werr != nil {
+		s.r.setErr(werr)
+	}
+	return err
+}
+
+func (s *recClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	var msg message
+	if err != nil {
+		msg = message{err: err}
+	} else {
+		msg = message{msg: s.r.scrub(s.method, m.(proto.Message), s.r.respScrubbers)}
+	}
+	_, werr := s.r.writeEntry(&entry{
+		kind:     rpb.Entry_RECV,
+		method:   s.method,
+		msg:      msg,
+		streamID: s.streamID,
+	})
+	if werr != nil {
+		s.r.setErr(werr)
+	}
+	return err
+}
+
+// CloseSend records the client's half-close as a SEND entry carrying
+// io.EOF, so replay can reproduce it at the same point in the stream.
+func (s *recClientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if !s.recordSends {
+		return err
+	}
+	msg := message{err: io.EOF}
+	if err != nil {
+		msg = message{err: err}
+	}
+	_, werr := s.r.writeEntry(&entry{
+		kind:     rpb.Entry_SEND,
+		method:   s.method,
+		msg:      msg,
+		streamID: s.streamID,
+	})
+	if werr != nil {
+		s.r.setErr(werr)
+	}
+	return err
+}
+
+// writeEntry assigns e the next entry index and writes it, returning the
+// index assigned so later entries can refer back to it.
+func (r *Recorder) writeEntry(e *entry) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.next++
+	idx := r.next
+	var err error
+	if r.json {
+		err = writeEntryJSON(r.w, e)
+	} else {
+		err = writeEntry(r.w, e)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return idx, nil
+}
+
+func (r *Recorder) setErr(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
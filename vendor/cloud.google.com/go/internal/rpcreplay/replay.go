@@ -0,0 +1,515 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcreplay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	rpb "cloud.google.com/go/internal/rpcreplay/proto/rpcreplay"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// A Replayer replays RPCs recorded by a Recorder.
+type Replayer struct {
+	headerFilter
+
+	initial []byte
+	f       *os.File
+
+	mu sync.Mutex
+	// requests maps method name to the recorded request/response pairs for
+	// that method, in recorded order.
+	requests map[string][]*replayEntry
+	// streams maps method name to the recorded streaming calls (client-,
+	// server- or bidi-streaming) for that method, in recorded order.
+	streams      map[string][]*replayStream
+	matcher      Matcher
+	reqScrubbers []Scrubber
+
+	// deadlineFactor scales down every recorded deadline before it is
+	// honored, so CI runs don't have to wait out long timeouts in real
+	// time. Set by SpeedUpDeadlines; 0 means no speedup.
+	deadlineFactor float64
+
+	// keepaliveParams, if non-nil, is passed to grpc.Dial by DialOptions so
+	// a replay connection can be tuned the same way the recording one was.
+	keepaliveParams *keepalive.ClientParameters
+}
+
+// replayEntry is one recorded request and the RESPONSE entry that refers
+// back to it.
+type replayEntry struct {
+	req       *entry
+	responses []*entry
+	used      bool
+}
+
+// replayStream is one recorded streaming call: the REQUEST entry that
+// opened it, and the SEND and RECV entries exchanged over it afterward.
+// sends and recvs are kept as separate queues, each in recorded order,
+// so a replayed bidi stream can advance its send side and its receive
+// side independently, the way a real one would.
+type replayStream struct {
+	req   *entry
+	sends []*entry
+	recvs []*entry
+	used  bool
+}
+
+// NewReplayer creates a Replayer that reads from filename.
+func NewReplayer(filename string) (*Replayer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	rep, err := NewReplayerReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	rep.f = f
+	return rep, nil
+}
+
+// NewReplayerReader creates a Replayer that reads from r. The binary and
+// JSON transcript formats are both accepted; NewReplayerReader detects
+// which one is present from the file header. NewReplayerReader is for
+// advanced use; most users should call NewReplayer.
+func NewReplayerReader(r io.Reader) (*Replayer, error) {
+	br := bufio.NewReader(r)
+	initial, isJSON, err := detectAndReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	return newReplayer(br, initial, isJSON)
+}
+
+// NewReplayerReaderJSON creates a Replayer that reads a JSON transcript,
+// as written by NewRecorderWriterJSON, from r.
+func NewReplayerReaderJSON(r io.Reader) (*Replayer, error) {
+	br := bufio.NewReader(r)
+	var magic [len(fileHeaderJSON)]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) != fileHeaderJSON {
+		return nil, fmt.Errorf("rpcreplay: bad JSON transcript header %q", magic[:])
+	}
+	initial, err := readHeaderJSON(br)
+	if err != nil {
+		return nil, err
+	}
+	return newReplayer(br, initial, true)
+}
+
+// newReplayer reads the body of a recording, in either format, from br.
+func newReplayer(br *bufio.Reader, initial []byte, isJSON bool) (*Replayer, error) {
+	rep := &Replayer{
+		initial:  initial,
+		requests: map[string][]*replayEntry{},
+		streams:  map[string][]*replayStream{},
+	}
+	byIndex := map[int]*replayEntry{}
+	byStreamID := map[int]*replayStream{}
+	idx := 0
+	for {
+		var e *entry
+		var err error
+		if isJSON {
+			e, err = readEntryJSON(br)
+		} else {
+			e, err = readEntry(br)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		idx++
+		switch e.kind {
+		case rpb.Entry_REQUEST:
+			if e.streamID != 0 {
+				rs := &replayStream{req: e}
+				byStreamID[e.streamID] = rs
+				rep.streams[e.method] = append(rep.streams[e.method], rs)
+			} else {
+				re := &replayEntry{req: e}
+				byIndex[idx] = re
+				rep.requests[e.method] = append(rep.requests[e.method], re)
+			}
+		case rpb.Entry_RESPONSE:
+			re, ok := byIndex[e.refIndex]
+			if !ok {
+				return nil, fmt.Errorf("rpcreplay: entry %d refers to unknown request %d", idx, e.refIndex)
+			}
+			re.responses = append(re.responses, e)
+		case rpb.Entry_SEND:
+			rs, ok := byStreamID[e.streamID]
+			if !ok {
+				return nil, fmt.Errorf("rpcreplay: entry %d refers to unknown stream %d", idx, e.streamID)
+			}
+			rs.sends = append(rs.sends, e)
+		case rpb.Entry_RECV:
+			rs, ok := byStreamID[e.streamID]
+			if !ok {
+				return nil, fmt.Errorf("rpcreplay: entry %d refers to unknown stream %d", idx, e.streamID)
+			}
+			rs.recvs = append(rs.recvs, e)
+		default:
+			return nil, fmt.Errorf("rpcreplay: entry %d has unknown kind %v", idx, e.kind)
+		}
+	}
+	return rep, nil
+}
+
+// IgnoreHeaders marks the given (case-insensitive) outgoing metadata keys
+// to be excluded when matching a live request against the ones recorded.
+// It should be called with the same keys passed to the Recorder's
+// IgnoreHeaders when the recording was made.
+func (r *Replayer) IgnoreHeaders(keys ...string) { r.ignoreHeaders(keys...) }
+
+// RedactHeaders marks the given (case-insensitive) outgoing metadata keys
+// to have their values replaced with the same fixed placeholder the
+// Recorder uses before a live request is matched against the ones
+// recorded. The key itself still takes part in matching. It should be
+// called with the same keys passed to the Recorder's RedactHeaders when
+// the recording was made, so that a live request carrying the real value
+// of a redacted header still matches the "REDACTED" placeholder that was
+// recorded in its place.
+func (r *Replayer) RedactHeaders(keys ...string) { r.redactHeaders(keys...) }
+
+// SetMatcher registers m to decide whether a live request matches a
+// recorded one, replacing the default of proto.Equal. It runs inside the
+// replay interceptor, after any registered request scrubbers, in place of
+// the usual exact-match lookup.
+func (r *Replayer) SetMatcher(m Matcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.matcher = m
+}
+
+// AddRequestScrubber registers a Scrubber that is applied to the live
+// request message before it is compared against recorded requests. It
+// should normalize the same fields a Recorder scrubber normalized when the
+// recording was made.
+func (r *Replayer) AddRequestScrubber(s Scrubber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reqScrubbers = append(r.reqScrubbers, s)
+}
+
+// Initial returns the initial state saved when the recording was made.
+func (r *Replayer) Initial() []byte {
+	return r.initial
+}
+
+// SpeedUpDeadlines scales every recorded deadline down by factor before it
+// is honored during replay, so tests with long timeouts don't have to wait
+// out the real duration in CI. For example, a factor of 10 makes a
+// recorded 30s deadline behave like a 3s one. The default factor, 1, does
+// no speedup.
+func (r *Replayer) SpeedUpDeadlines(factor float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadlineFactor = factor
+}
+
+// SetKeepaliveParams sets the keepalive parameters that DialOptions will
+// pass to grpc.Dial, so a replay connection used for long-lived streaming
+// tests can be tuned the same way the recording connection was.
+func (r *Replayer) SetKeepaliveParams(kp keepalive.ClientParameters) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keepaliveParams = &kp
+}
+
+// DialOptions returns the options that must be passed to grpc.Dial to enable
+// replaying.
+func (r *Replayer) DialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(r.interceptUnary),
+		grpc.WithStreamInterceptor(r.interceptStream),
+	}
+	if r.keepaliveParams != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*r.keepaliveParams))
+	}
+	return opts
+}
+
+// Close closes the Replayer.
+func (r *Replayer) Close() error {
+	if r.f != nil {
+		return r.f.Close()
+	}
+	return nil
+}
+
+func (r *Replayer) interceptUnary(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	outMD, _ := metadata.FromOutgoingContext(ctx)
+	scrubbed := r.scrubRequest(method, req.(proto.Message))
+	re, err := r.lookup(method, scrubbed, r.apply(outMD))
+	if err != nil {
+		return err
+	}
+	if err := r.honorDeadline(ctx, re.req); err != nil {
+		return err
+	}
+	if len(re.responses) != 1 {
+		return fmt.Errorf("rpcreplay: method %s: got %d recorded responses, want 1", method, len(re.responses))
+	}
+	resp := re.responses[0]
+	setCallOptionMetadata(opts, resp.header, resp.trailer)
+	if resp.msg.err != nil {
+		return resp.msg.err
+	}
+	proto.Merge(res.(proto.Message), resp.msg.msg)
+	return nil
+}
+
+// setCallOptionMetadata copies header and trailer into any
+// grpc.HeaderCallOption/grpc.TrailerCallOption the caller passed in, the
+// way a real invocation would populate them from the wire.
+func setCallOptionMetadata(opts []grpc.CallOption, header, trailer metadata.MD) {
+	for _, o := range opts {
+		switch o := o.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = trailer
+		}
+	}
+}
+
+func (r *Replayer) interceptStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	outMD, _ := metadata.FromOutgoingContext(ctx)
+	rs, err := r.lookupStream(method, r.apply(outMD))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.honorDeadline(ctx, rs.req); err != nil {
+		return nil, err
+	}
+	return &replayClientStream{ctx: ctx, r: r, method: method, rs: rs, recordSends: desc.ClientStreams}, nil
+}
+
+// honorDeadline reproduces the timeout behavior the original call saw. If
+// req had a deadline when it was recorded, and ctx's own deadline would
+// elapse before that recorded duration does (scaled by any factor set via
+// SpeedUpDeadlines), honorDeadline waits for ctx to actually be done and
+// returns a codes.DeadlineExceeded error, or codes.Canceled if ctx was
+// canceled rather than timing out, the way the live call would have
+// failed. Otherwise it returns immediately, since the call had enough time
+// budget to succeed as recorded.
+func (r *Replayer) honorDeadline(ctx context.Context, req *entry) error {
+	if !req.hasDeadline {
+		return nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	factor := r.deadlineFactor
+	r.mu.Unlock()
+	if factor <= 0 {
+		factor = 1
+	}
+	want := time.Duration(float64(req.timeout) / factor)
+	if time.Until(deadline) >= want {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return status.Error(codes.Canceled, ctx.Err().Error())
+		}
+		return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+	case <-time.After(want):
+		return nil
+	}
+}
+
+// effectiveMatcher returns the Matcher to use when comparing a live
+// message against a recorded one, defaulting to proto.Equal when no
+// Matcher has been registered via SetMatcher.
+func (r *Replayer) effectiveMatcher() Matcher {
+	r.mu.Lock()
+	m := r.matcher
+	r.mu.Unlock()
+	if m == nil {
+		return func(_ string, got, want proto.Message) bool { return proto.Equal(got, want) }
+	}
+	return m
+}
+
+// scrubRequest applies the registered request scrubbers to msg, the way
+// they were applied to the request before it was recorded.
+func (r *Replayer) scrubRequest(method string, msg proto.Message) proto.Message {
+	r.mu.Lock()
+	scrubbers := r.reqScrubbers
+	r.mu.Unlock()
+	for _, s := range scrubbers {
+		msg = s(method, msg)
+	}
+	return msg
+}
+
+// lookup finds and marks used the first unused recorded request for method
+// whose message and metadata match req and md.
+func (r *Replayer) lookup(method string, req proto.Message, md metadata.MD) (*replayEntry, error) {
+	matcher := r.effectiveMatcher()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, re := range r.requests[method] {
+		if re.used {
+			continue
+		}
+		if matcher(method, req, re.req.msg.msg) && reflect.DeepEqual(re.req.reqMD, md) {
+			re.used = true
+			return re, nil
+		}
+	}
+	return nil, fmt.Errorf("rpcreplay: no recorded request found for method %s, message %v", method, req)
+}
+
+// lookupStream finds and marks used the first unused recorded stream for
+// method whose outgoing metadata matches md.
+func (r *Replayer) lookupStream(method string, md metadata.MD) (*replayStream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rs := range r.streams[method] {
+		if rs.used {
+			continue
+		}
+		if reflect.DeepEqual(rs.req.reqMD, md) {
+			rs.used = true
+			return rs, nil
+		}
+	}
+	return nil, fmt.Errorf("rpcreplay: no recorded stream found for method %s", method)
+}
+
+// replayClientStream is a grpc.ClientStream backed by a recorded sequence
+// of SEND and RECV entries instead of a live connection. SendMsg and
+// RecvMsg draw from separate queues of recorded entries, so a bidi stream
+// whose client sends and receives concurrently replays with its send
+// order and receive order each preserved, without forcing the two to
+// alternate the way they happened to interleave while recording.
+type replayClientStream struct {
+	ctx    context.Context
+	r      *Replayer
+	method string
+	rs     *replayStream
+
+	// recordSends mirrors desc.ClientStreams at call time: false for a
+	// server-streaming call, whose single request is sent via an implicit
+	// SendMsg/CloseSend that the Recorder never wrote as a SEND entry.
+	recordSends bool
+
+	mu      sync.Mutex
+	sendIdx int // index of the next entry in rs.sends to consume
+	recvIdx int // index of the next entry in rs.recvs to consume
+}
+
+func (s *replayClientStream) nextSend() (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sendIdx >= len(s.rs.sends) {
+		return nil, fmt.Errorf("rpcreplay: method %s: no more recorded sends", s.method)
+	}
+	e := s.rs.sends[s.sendIdx]
+	s.sendIdx++
+	return e, nil
+}
+
+func (s *replayClientStream) nextRecv() (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recvIdx >= len(s.rs.recvs) {
+		return nil, fmt.Errorf("rpcreplay: method %s: no more recorded receives", s.method)
+	}
+	e := s.rs.recvs[s.recvIdx]
+	s.recvIdx++
+	return e, nil
+}
+
+// SendMsg matches m, after scrubbing, against the next recorded SEND for
+// this stream, using the same pluggable Matcher and request scrubbers
+// that a unary call's request is matched with. A client under test that
+// sends something other than what was recorded is reported as an error
+// rather than silently accepted.
+func (s *replayClientStream) SendMsg(m interface{}) error {
+	if !s.recordSends {
+		return nil
+	}
+	e, err := s.nextSend()
+	if err != nil {
+		return err
+	}
+	if e.msg.err != nil {
+		return e.msg.err
+	}
+	got := s.r.scrubRequest(s.method, m.(proto.Message))
+	if !s.r.effectiveMatcher()(s.method, got, e.msg.msg) {
+		return fmt.Errorf("rpcreplay: method %s: sent message %v does not match recorded send %v", s.method, got, e.msg.msg)
+	}
+	return nil
+}
+
+func (s *replayClientStream) RecvMsg(m interface{}) error {
+	e, err := s.nextRecv()
+	if err != nil {
+		return err
+	}
+	if e.msg.err != nil {
+		return e.msg.err
+	}
+	proto.Merge(m.(proto.Message), e.msg.msg)
+	return nil
+}
+
+// CloseSend consumes the SEND entry recorded for the client's half-close.
+func (s *replayClientStream) CloseSend() error {
+	if !s.recordSends {
+		return nil
+	}
+	e, err := s.nextSend()
+	if err != nil {
+		return err
+	}
+	if e.msg.err == io.EOF {
+		return nil
+	}
+	return e.msg.err
+}
+
+func (s *replayClientStream) Header() (metadata.MD, error) { return nil, nil }
+
+func (s *replayClientStream) Trailer() metadata.MD { return nil }
+
+func (s *replayClientStream) Context() context.Context { return s.ctx }
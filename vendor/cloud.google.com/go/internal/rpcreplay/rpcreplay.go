@@ -0,0 +1,368 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpcreplay supports the recording and replaying of gRPC calls.
+// Recording happens via an intercepting Recorder, and replaying happens
+// via an intercepting Replayer. Both are transparent to the client:
+// neither requires any change to the way the client makes RPC calls.
+//
+// The recorded calls are stored in a file whose format is private to this
+// package. The file consists of a sequence of records, one per RPC message
+// sent or received, along with an initial record holding some
+// caller-supplied bytes (typically used to store the state of the backend
+// at the start of the recording).
+package rpcreplay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	rpb "cloud.google.com/go/internal/rpcreplay/proto/rpcreplay"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fileHeader is the first bytes in a valid rpcreplay file. It lets us
+// detect files written in a format we don't understand, or non-rpcreplay
+// files entirely.
+const fileHeader = "gRPCReplay\n"
+
+// entry is one recorded event: an outgoing request (or the opening of a
+// stream), an incoming response, or an outgoing or incoming stream item.
+type entry struct {
+	kind     rpb.Entry_Kind
+	method   string
+	msg      message
+	refIndex int // index of corresponding request or response, if any; 1-based
+
+	// reqMD is the metadata.MD sent by the client via
+	// metadata.NewOutgoingContext; set only on REQUEST entries.
+	reqMD metadata.MD
+
+	// header and trailer are the header and trailer metadata returned by
+	// the server; set only on RESPONSE entries.
+	header  metadata.MD
+	trailer metadata.MD
+
+	// streamID identifies the ClientStream/ServerStream this entry belongs
+	// to; zero for unary RPCs.
+	streamID int
+
+	// hasDeadline and timeout record the time remaining on the caller's
+	// context deadline when a REQUEST entry was made, if it had one.
+	hasDeadline bool
+	timeout     time.Duration
+}
+
+func (e1 *entry) equal(e2 *entry) bool {
+	if e1 == nil && e2 == nil {
+		return true
+	}
+	if e1 == nil || e2 == nil {
+		return false
+	}
+	return e1.kind == e2.kind &&
+		e1.method == e2.method &&
+		e1.msg.equal(&e2.msg) &&
+		e1.refIndex == e2.refIndex &&
+		reflect.DeepEqual(e1.reqMD, e2.reqMD) &&
+		reflect.DeepEqual(e1.header, e2.header) &&
+		reflect.DeepEqual(e1.trailer, e2.trailer) &&
+		e1.streamID == e2.streamID &&
+		e1.hasDeadline == e2.hasDeadline &&
+		e1.timeout == e2.timeout
+}
+
+// message holds either a proto.Message or an error, never both. It
+// represents the payload of a single gRPC call or stream item.
+type message struct {
+	msg proto.Message
+	err error
+}
+
+func (m1 *message) equal(m2 *message) bool {
+	if !errEqual(m1.err, m2.err) {
+		return false
+	}
+	if m1.err != nil {
+		return true
+	}
+	return proto.Equal(m1.msg, m2.msg)
+}
+
+func errEqual(e1, e2 error) bool {
+	if e1 == nil && e2 == nil {
+		return true
+	}
+	if e1 == nil || e2 == nil {
+		return false
+	}
+	if e1 == io.EOF || e2 == io.EOF {
+		return e1 == e2
+	}
+	s1, ok1 := status.FromError(e1)
+	s2, ok2 := status.FromError(e2)
+	if !ok1 || !ok2 {
+		return e1.Error() == e2.Error()
+	}
+	return s1.Code() == s2.Code() && s1.Message() == s2.Message()
+}
+
+// contextTimeout reports whether ctx carries a deadline and, if so, how
+// much time remained on it when this was called.
+func contextTimeout(ctx context.Context) (bool, time.Duration) {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return false, 0
+	}
+	return true, time.Until(d)
+}
+
+// mdToProto converts a metadata.MD to its wire representation. It returns
+// nil if md is empty, so that entries recorded before metadata support was
+// added (or with no metadata) round-trip without spurious empty Metadata
+// messages.
+func mdToProto(md metadata.MD) *rpb.Metadata {
+	if len(md) == 0 {
+		return nil
+	}
+	pm := &rpb.Metadata{Md: make(map[string]*rpb.Strings, len(md))}
+	for k, vs := range md {
+		pm.Md[k] = &rpb.Strings{Val: vs}
+	}
+	return pm
+}
+
+func protoToMD(pm *rpb.Metadata) metadata.MD {
+	if pm == nil {
+		return nil
+	}
+	md := make(metadata.MD, len(pm.Md))
+	for k, vs := range pm.Md {
+		md[k] = vs.Val
+	}
+	return md
+}
+
+// writeEntry marshals e as a rpb.Entry proto and writes it to w as a
+// length-prefixed record.
+func writeEntry(w io.Writer, e *entry) error {
+	pe := &rpb.Entry{
+		Kind:            e.kind,
+		Method:          e.method,
+		RefIndex:        int32(e.refIndex),
+		RequestMetadata: mdToProto(e.reqMD),
+		ResponseHeader:  mdToProto(e.header),
+		ResponseTrailer: mdToProto(e.trailer),
+		StreamId:        int32(e.streamID),
+		HasDeadline:     e.hasDeadline,
+		DeadlineNanos:   int64(e.timeout),
+	}
+	if e.msg.err == io.EOF {
+		pe.IsError = true
+		pe.IsEOF = true
+	} else if e.msg.err != nil {
+		s, _ := status.FromError(e.msg.err)
+		pe.IsError = true
+		pe.ErrorCode = int32(s.Code())
+		pe.ErrorMessage = s.Message()
+	} else if e.msg.msg != nil {
+		any, err := ptypes.MarshalAny(e.msg.msg)
+		if err != nil {
+			return err
+		}
+		pe.Message = any
+	}
+	bytes, err := proto.Marshal(pe)
+	if err != nil {
+		return err
+	}
+	return writeRecord(w, bytes)
+}
+
+func readEntry(r io.Reader) (*entry, error) {
+	buf, err := readRecord(r)
+	if err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return nil, nil
+	}
+	var pe rpb.Entry
+	if err := proto.Unmarshal(buf, &pe); err != nil {
+		return nil, err
+	}
+	e := &entry{
+		kind:        pe.Kind,
+		method:      pe.Method,
+		refIndex:    int(pe.RefIndex),
+		reqMD:       protoToMD(pe.RequestMetadata),
+		header:      protoToMD(pe.ResponseHeader),
+		trailer:     protoToMD(pe.ResponseTrailer),
+		streamID:    int(pe.StreamId),
+		hasDeadline: pe.HasDeadline,
+		timeout:     time.Duration(pe.DeadlineNanos),
+	}
+	switch {
+	case pe.IsError && pe.IsEOF:
+		e.msg = message{err: io.EOF}
+	case pe.IsError:
+		e.msg = message{err: status.Error(codes.Code(pe.ErrorCode), pe.ErrorMessage)}
+	case pe.Message != nil:
+		var dm ptypes.DynamicAny
+		if err := ptypes.UnmarshalAny(pe.Message, &dm); err != nil {
+			return nil, err
+		}
+		e.msg = message{msg: dm.Message}
+	}
+	return e, nil
+}
+
+// writeHeader writes the file header, followed by the caller-supplied
+// initial state, to w.
+func writeHeader(w io.Writer, initial []byte) error {
+	if _, err := io.WriteString(w, fileHeader); err != nil {
+		return err
+	}
+	return writeRecord(w, initial)
+}
+
+// headerFilter controls which incoming/outgoing metadata keys are dropped
+// or redacted before they are written to a recording. It is embedded in
+// both Recorder and Replayer so the two stay in sync: a key ignored at
+// record time must also be ignored when the Replayer matches live
+// metadata against what was recorded.
+type headerFilter struct {
+	ignore map[string]bool
+	redact map[string]bool
+}
+
+// ignoreHeaders marks the given (case-insensitive) metadata keys to be
+// dropped entirely rather than recorded or matched.
+func (f *headerFilter) ignoreHeaders(keys ...string) {
+	if f.ignore == nil {
+		f.ignore = map[string]bool{}
+	}
+	for _, k := range keys {
+		f.ignore[strings.ToLower(k)] = true
+	}
+}
+
+// redactHeaders marks the given (case-insensitive) metadata keys to have
+// their values replaced with a fixed placeholder before being recorded,
+// so recordings can be safely committed to version control.
+func (f *headerFilter) redactHeaders(keys ...string) {
+	if f.redact == nil {
+		f.redact = map[string]bool{}
+	}
+	for _, k := range keys {
+		f.redact[strings.ToLower(k)] = true
+	}
+}
+
+const redactedValue = "REDACTED"
+
+// reservedHeaders are pseudo-headers that gRPC itself populates on every
+// call, such as "content-type", regardless of what the server handler
+// sets. They carry no application information, so they are always
+// dropped rather than left for the caller to ignore explicitly.
+var reservedHeaders = map[string]bool{
+	"content-type": true,
+}
+
+// apply returns a copy of md with reserved and ignored keys removed and
+// redacted keys' values replaced. It returns nil if nothing is left, so
+// the result compares equal to metadata read back from a recording, where
+// empty metadata is stored as absent.
+func (f *headerFilter) apply(md metadata.MD) metadata.MD {
+	if len(md) == 0 {
+		return nil
+	}
+	out := make(metadata.MD, len(md))
+	for k, vs := range md {
+		lk := strings.ToLower(k)
+		if reservedHeaders[lk] || f.ignore[lk] {
+			continue
+		}
+		if f.redact[lk] {
+			out[k] = make([]string, len(vs))
+			for i := range vs {
+				out[k][i] = redactedValue
+			}
+			continue
+		}
+		out[k] = vs
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// readHeader reads and validates the file header, returning the initial
+// state that follows it.
+func readHeader(r io.Reader) ([]byte, error) {
+	var got [len(fileHeader)]byte
+	if _, err := io.ReadFull(r, got[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("rpcreplay: short or missing header")
+		}
+		return nil, err
+	}
+	if string(got[:]) != fileHeader {
+		return nil, fmt.Errorf("rpcreplay: bad file header %q", got[:])
+	}
+	return readRecord(r)
+}
+
+// writeRecord writes data as a single length-prefixed record to w.
+func writeRecord(w io.Writer, data []byte) error {
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(lenBuf, uint64(len(data)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readRecord reads a single length-prefixed record from r, returning
+// (nil, nil) at a clean end of stream.
+func readRecord(r io.Reader) ([]byte, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
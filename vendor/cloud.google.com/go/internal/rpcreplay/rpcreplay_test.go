@@ -15,17 +15,24 @@
 package rpcreplay
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	ipb "cloud.google.com/go/internal/rpcreplay/proto/intstore"
 	rpb "cloud.google.com/go/internal/rpcreplay/proto/rpcreplay"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -101,6 +108,340 @@ func TestEntryIO(t *testing.T) {
 	}
 }
 
+func TestEntryIOMetadata(t *testing.T) {
+	want := &entry{
+		kind:   rpb.Entry_REQUEST,
+		method: "method",
+		msg:    message{msg: &rpb.Entry{}},
+		reqMD:  metadata.MD{"k1": {"v1", "v2"}},
+	}
+	buf := &bytes.Buffer{}
+	if err := writeEntry(buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readEntry(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.equal(want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestJSONEntryIO(t *testing.T) {
+	for i, want := range []*entry{
+		{
+			kind:   rpb.Entry_REQUEST,
+			method: "/intstore.IntStore/Set",
+			msg:    message{msg: &ipb.Item{Name: "a", Value: 1}},
+			reqMD:  metadata.MD{"k": {"v"}},
+		},
+		{
+			kind:     rpb.Entry_RESPONSE,
+			msg:      message{err: status.Error(codes.NotFound, "not found")},
+			refIndex: 1,
+		},
+	} {
+		buf := &bytes.Buffer{}
+		if err := writeEntryJSON(buf, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readEntryJSON(bufio.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.equal(want) {
+			t.Errorf("#%d: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+	binBuf := record(t, srv)
+
+	jsonBuf := &bytes.Buffer{}
+	if err := ConvertToJSON(binBuf, jsonBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayerReaderJSON(bytes.NewReader(jsonBuf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rep.Initial(), initialState) {
+		t.Fatalf("got %v, want %v", rep.Initial(), initialState)
+	}
+	testService(t, srv.Addr, rep.DialOptions())
+
+	backBuf := &bytes.Buffer{}
+	if err := ConvertToBinary(bytes.NewReader(jsonBuf.Bytes()), backBuf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClearFields(t *testing.T) {
+	scrub := ClearFields("Name")
+	item := &ipb.Item{Name: "a", Value: 1}
+	got := scrub("", item).(*ipb.Item)
+	if got.Name != "" || got.Value != 1 {
+		t.Errorf("got %+v, want Name cleared and Value untouched", got)
+	}
+	if item.Name != "a" {
+		t.Errorf("scrubber mutated its input: %+v", item)
+	}
+}
+
+func TestFuzzyMatcher(t *testing.T) {
+	m := FuzzyMatcher()
+	want := &ipb.GetRequest{Name: "a"}
+	if !m("", &ipb.GetRequest{Name: "a"}, want) {
+		t.Error("got no match for identical messages")
+	}
+	if m("", &ipb.GetRequest{Name: "b"}, want) {
+		t.Error("got a match for a set field with a different value")
+	}
+	if !m("", &ipb.GetRequest{Name: "anything"}, &ipb.GetRequest{}) {
+		t.Error("got no match when the recorded field was unset (wildcard)")
+	}
+}
+
+func TestHeaderFilter(t *testing.T) {
+	var f headerFilter
+	f.redactHeaders("Authorization")
+	f.ignoreHeaders("x-goog-request-params")
+	md := metadata.MD{
+		"authorization":         {"Bearer secret"},
+		"x-goog-request-params": {"name=projects/p"},
+		"x-request-id":          {"abc"},
+	}
+	got := f.apply(md)
+	want := metadata.MD{
+		"authorization": {redactedValue},
+		"x-request-id":  {"abc"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// timestampMsg is a minimal proto.Message with a *timestamp.Timestamp
+// field, since none of the IntStore messages have one, so RoundTimestamps
+// has something to round.
+type timestampMsg struct {
+	At *timestamp.Timestamp
+}
+
+func (m *timestampMsg) Reset()         { *m = timestampMsg{} }
+func (m *timestampMsg) String() string { return proto.CompactTextString(m) }
+func (*timestampMsg) ProtoMessage()    {}
+
+func TestRoundTimestamps(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 37, 0, time.UTC)
+	ts, err := ptypes.TimestampProto(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &timestampMsg{At: ts}
+	scrub := RoundTimestamps(time.Minute, "At")
+	got := scrub("", msg).(*timestampMsg)
+	gotTime, err := ptypes.Timestamp(got.At)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := at.Truncate(time.Minute); !gotTime.Equal(want) {
+		t.Errorf("got %v, want %v", gotTime, want)
+	}
+	if origTime, err := ptypes.Timestamp(msg.At); err != nil || !origTime.Equal(at) {
+		t.Errorf("scrubber mutated its input: %+v", msg)
+	}
+}
+
+// TestReplayFuzzyMatcher records a Set call whose request has a zero
+// Value, then replays it against a live client that sends a different
+// Value, proving FuzzyMatcher tolerates the kind of non-deterministic
+// field it's meant for.
+func TestReplayFuzzyMatcher(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+
+	buf := &bytes.Buffer{}
+	rec, err := NewRecorderWriter(buf, initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recConn, err := grpc.Dial(srv.Addr, append([]grpc.DialOption{grpc.WithInsecure()}, rec.DialOptions()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipb.NewIntStoreClient(recConn).Set(context.Background(), &ipb.Item{Name: "a", Value: 0}); err != nil {
+		t.Fatal(err)
+	}
+	recConn.Close()
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayerReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep.SetMatcher(FuzzyMatcher())
+	repConn, err := grpc.Dial(srv.Addr, append([]grpc.DialOption{grpc.WithInsecure()}, rep.DialOptions()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repConn.Close()
+	res, err := ipb.NewIntStoreClient(repConn).Set(context.Background(), &ipb.Item{Name: "a", Value: 123})
+	if err != nil {
+		t.Fatalf("replay with a different live Value: %v", err)
+	}
+	if res.PrevValue != 0 {
+		t.Errorf("got PrevValue %d, want 0", res.PrevValue)
+	}
+}
+
+// TestReplayRequestScrubber records and replays a Set call whose Value
+// differs between the two live calls, relying on a request scrubber
+// registered on both the Recorder and the Replayer to normalize it away
+// before matching, the way it would have to normalize a timestamp or
+// request ID generated fresh on each run.
+func TestReplayRequestScrubber(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+
+	buf := &bytes.Buffer{}
+	rec, err := NewRecorderWriter(buf, initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.AddRequestScrubber(ClearFields("Value"))
+	recConn, err := grpc.Dial(srv.Addr, append([]grpc.DialOption{grpc.WithInsecure()}, rec.DialOptions()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipb.NewIntStoreClient(recConn).Set(context.Background(), &ipb.Item{Name: "a", Value: 7}); err != nil {
+		t.Fatal(err)
+	}
+	recConn.Close()
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayerReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep.AddRequestScrubber(ClearFields("Value"))
+	repConn, err := grpc.Dial(srv.Addr, append([]grpc.DialOption{grpc.WithInsecure()}, rep.DialOptions()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repConn.Close()
+	res, err := ipb.NewIntStoreClient(repConn).Set(context.Background(), &ipb.Item{Name: "a", Value: 999})
+	if err != nil {
+		t.Fatalf("replay with a different live Value: %v", err)
+	}
+	if res.PrevValue != 0 {
+		t.Errorf("got PrevValue %d, want 0", res.PrevValue)
+	}
+}
+
+func TestHonorDeadline(t *testing.T) {
+	rep := &Replayer{}
+	req := &entry{hasDeadline: true, timeout: 100 * time.Millisecond}
+
+	// No deadline on the live context: the recorded one is irrelevant.
+	if err := rep.honorDeadline(context.Background(), req); err != nil {
+		t.Errorf("no live deadline: got %v, want nil", err)
+	}
+
+	// Live deadline has at least as much time as was recorded: succeeds
+	// immediately.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rep.honorDeadline(ctx, req); err != nil {
+		t.Errorf("ample live deadline: got %v, want nil", err)
+	}
+
+	// Live deadline is tighter than what was recorded: the call should
+	// fail with DeadlineExceeded once the live deadline actually elapses.
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel2()
+	err := rep.honorDeadline(ctx2, req)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("tight live deadline: got %v, want DeadlineExceeded", err)
+	}
+
+	// SpeedUpDeadlines shrinks the recorded timeout, so a live deadline
+	// that would otherwise be too tight now has enough budget.
+	rep.SpeedUpDeadlines(1000)
+	ctx3, cancel3 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel3()
+	if err := rep.honorDeadline(ctx3, req); err != nil {
+		t.Errorf("sped-up deadline: got %v, want nil", err)
+	}
+}
+
+// TestReplayHeaderTrailer checks that interceptUnary populates any
+// grpc.Header/grpc.Trailer call options from the header and trailer
+// metadata of the recorded RESPONSE entry, the way a live call would
+// populate them from the wire.
+func TestReplayHeaderTrailer(t *testing.T) {
+	rep := &Replayer{requests: map[string][]*replayEntry{
+		"/intstore.IntStore/Get": {
+			{
+				req: &entry{
+					method: "/intstore.IntStore/Get",
+					msg:    message{msg: &ipb.GetRequest{Name: "a"}},
+				},
+				responses: []*entry{
+					{
+						header:  metadata.MD{"x-header": {"h"}},
+						trailer: metadata.MD{"x-trailer": {"t"}},
+						msg:     message{msg: &ipb.Item{Name: "a", Value: 1}},
+					},
+				},
+			},
+		},
+	}}
+	var header, trailer metadata.MD
+	res := &ipb.Item{}
+	err := rep.interceptUnary(context.Background(), "/intstore.IntStore/Get",
+		&ipb.GetRequest{Name: "a"}, res, nil, nil, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(header, metadata.MD{"x-header": {"h"}}) {
+		t.Errorf("header: got %v, want {x-header: [h]}", header)
+	}
+	if !reflect.DeepEqual(trailer, metadata.MD{"x-trailer": {"t"}}) {
+		t.Errorf("trailer: got %v, want {x-trailer: [t]}", trailer)
+	}
+}
+
+func TestKeepaliveDialOptions(t *testing.T) {
+	kp := keepalive.ClientParameters{Time: 30 * time.Second}
+
+	rec, err := NewRecorderWriter(&bytes.Buffer{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(rec.DialOptions())
+	rec.SetKeepaliveParams(kp)
+	if got := len(rec.DialOptions()); got != before+1 {
+		t.Errorf("Recorder.DialOptions: got %d options, want %d", got, before+1)
+	}
+
+	rep := &Replayer{}
+	before = len(rep.DialOptions())
+	rep.SetKeepaliveParams(kp)
+	if got := len(rep.DialOptions()); got != before+1 {
+		t.Errorf("Replayer.DialOptions: got %d options, want %d", got, before+1)
+	}
+}
+
 var initialState = []byte{1, 2, 3}
 
 func TestRecord(t *testing.T) {
@@ -229,3 +570,322 @@ func testService(t *testing.T, addr string, opts []grpc.DialOption) {
 		t.Errorf("got error type %T, want a grpc/status.Status", err)
 	}
 }
+
+func TestStreamingRecord(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+	buf := &bytes.Buffer{}
+	rec, err := NewRecorderWriter(buf, initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStreaming(t, srv.Addr, rec.DialOptions())
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readHeader(buf); err != nil {
+		t.Fatal(err)
+	}
+	var kinds []rpb.Entry_Kind
+	for {
+		e, err := readEntry(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			break
+		}
+		kinds = append(kinds, e.kind)
+	}
+	want := []rpb.Entry_Kind{
+		rpb.Entry_REQUEST, // SetStream
+		rpb.Entry_SEND,    // b=2
+		rpb.Entry_SEND,    // c=3
+		rpb.Entry_SEND,    // CloseSend
+		rpb.Entry_RECV,    // SetStreamResponse
+		rpb.Entry_REQUEST, // ListItems
+		rpb.Entry_RECV,    // an item
+		rpb.Entry_RECV,    // an item
+		rpb.Entry_RECV,    // io.EOF
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got  %v\nwant %v", kinds, want)
+	}
+}
+
+func TestStreamingReplay(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+
+	buf := &bytes.Buffer{}
+	rec, err := NewRecorderWriter(buf, initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStreaming(t, srv.Addr, rec.DialOptions())
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayerReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStreaming(t, srv.Addr, rep.DialOptions())
+}
+
+// testStreaming exercises the IntStore service's client-streaming
+// (SetStream) and server-streaming (ListItems) methods, one after the
+// other, so the recording holds both SEND and RECV entries.
+func testStreaming(t *testing.T, addr string, opts []grpc.DialOption) {
+	conn, err := grpc.Dial(addr,
+		append([]grpc.DialOption{grpc.WithInsecure()}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := ipb.NewIntStoreClient(conn)
+	ctx := context.Background()
+
+	setStream, err := client.SetStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []*ipb.Item{{Name: "b", Value: 2}, {Name: "c", Value: 3}} {
+		if err := setStream.Send(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setRes, err := setStream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setRes.NumSet != 2 {
+		t.Errorf("got NumSet %d, want 2", setRes.NumSet)
+	}
+
+	listStream, err := client.ListItems(ctx, &ipb.ListItemsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for {
+		_, err := listStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("got %d items, want 2", n)
+	}
+}
+
+// recordAndReplay runs run once against srv while recording, then again
+// against a Replayer built from that recording, so a test only has to
+// describe the RPC behavior it wants to exercise once.
+func recordAndReplay(t *testing.T, srv *intStoreServer, run func(addr string, opts []grpc.DialOption)) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	rec, err := NewRecorderWriter(buf, initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(srv.Addr, rec.DialOptions())
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayerReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(srv.Addr, rep.DialOptions())
+}
+
+func dialSync(t *testing.T, addr string, ctx context.Context, opts []grpc.DialOption) (ipb.IntStore_SyncClient, *grpc.ClientConn) {
+	t.Helper()
+	conn, err := grpc.Dial(addr, append([]grpc.DialOption{grpc.WithInsecure()}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := ipb.NewIntStoreClient(conn).Sync(ctx)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return stream, conn
+}
+
+// TestBidiStreamingEOF exercises the clean end of a Sync bidi stream: the
+// client half-closes and observes io.EOF once the server has nothing more
+// to send.
+func TestBidiStreamingEOF(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+	recordAndReplay(t, srv, func(addr string, opts []grpc.DialOption) {
+		stream, conn := dialSync(t, addr, context.Background(), opts)
+		defer conn.Close()
+		if err := stream.Send(&ipb.Item{Name: "a", Value: 5}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Value != 0 {
+			t.Errorf("got previous value %d, want 0", got.Value)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != io.EOF {
+			t.Errorf("got %v, want io.EOF", err)
+		}
+	})
+}
+
+// TestBidiStreamingMidStreamError exercises a Sync stream that ends with
+// an error in the middle, rather than a clean EOF.
+func TestBidiStreamingMidStreamError(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+	recordAndReplay(t, srv, func(addr string, opts []grpc.DialOption) {
+		stream, conn := dialSync(t, addr, context.Background(), opts)
+		defer conn.Close()
+		if err := stream.Send(&ipb.Item{Name: "a", Value: -1}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := stream.Recv()
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("got %v, want InvalidArgument", err)
+		}
+	})
+}
+
+// TestBidiStreamingCancellation exercises a Sync stream whose context is
+// canceled by the client partway through, rather than completing or
+// failing on its own.
+func TestBidiStreamingCancellation(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+	recordAndReplay(t, srv, func(addr string, opts []grpc.DialOption) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, conn := dialSync(t, addr, ctx, opts)
+		defer conn.Close()
+		if err := stream.Send(&ipb.Item{Name: "a", Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+			t.Errorf("got %v, want Canceled", err)
+		}
+	})
+}
+
+// syncStreamResult holds the outcome of driving one Sync stream to
+// completion, so it can be reported from a goroutine without calling the
+// *testing.T of the test that launched it.
+type syncStreamResult struct {
+	prevs []int32
+	err   error
+}
+
+// driveSyncStream opens its own Sync stream and, for each value, sends an
+// Item for name and records the previous value the server echoes back,
+// then half-closes and confirms the stream ends with io.EOF.
+func driveSyncStream(addr string, opts []grpc.DialOption, name string, values []int32) syncStreamResult {
+	conn, err := grpc.Dial(addr, append([]grpc.DialOption{grpc.WithInsecure()}, opts...)...)
+	if err != nil {
+		return syncStreamResult{err: err}
+	}
+	defer conn.Close()
+	stream, err := ipb.NewIntStoreClient(conn).Sync(context.Background())
+	if err != nil {
+		return syncStreamResult{err: err}
+	}
+	var prevs []int32
+	for _, v := range values {
+		if err := stream.Send(&ipb.Item{Name: name, Value: v}); err != nil {
+			return syncStreamResult{err: err}
+		}
+		got, err := stream.Recv()
+		if err != nil {
+			return syncStreamResult{err: err}
+		}
+		prevs = append(prevs, got.Value)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return syncStreamResult{err: err}
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		return syncStreamResult{err: err}
+	}
+	return syncStreamResult{prevs: prevs}
+}
+
+// TestConcurrentBidiStreams opens two Sync streams for the same method at
+// the same time, from separate goroutines, and interleaves their sends
+// and receives, both while recording and while replaying. It guards
+// against lookupStream pairing a live stream with the wrong recorded one
+// under real concurrency.
+func TestConcurrentBidiStreams(t *testing.T) {
+	srv := newIntStoreServer()
+	defer srv.stop()
+
+	run := func(addr string, opts []grpc.DialOption) (a, b syncStreamResult) {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a = driveSyncStream(addr, opts, "a", []int32{1, 2, 3})
+		}()
+		go func() {
+			defer wg.Done()
+			b = driveSyncStream(addr, opts, "b", []int32{10, 20, 30})
+		}()
+		wg.Wait()
+		return a, b
+	}
+
+	buf := &bytes.Buffer{}
+	rec, err := NewRecorderWriter(buf, initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantA, wantB := run(srv.Addr, rec.DialOptions())
+	if wantA.err != nil {
+		t.Fatalf("recording stream a: %v", wantA.err)
+	}
+	if wantB.err != nil {
+		t.Fatalf("recording stream b: %v", wantB.err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayerReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotA, gotB := run(srv.Addr, rep.DialOptions())
+	if gotA.err != nil {
+		t.Fatalf("replaying stream a: %v", gotA.err)
+	}
+	if gotB.err != nil {
+		t.Fatalf("replaying stream b: %v", gotB.err)
+	}
+	if !reflect.DeepEqual(gotA.prevs, wantA.prevs) {
+		t.Errorf("stream a: got %v, want %v", gotA.prevs, wantA.prevs)
+	}
+	if !reflect.DeepEqual(gotB.prevs, wantB.prevs) {
+		t.Errorf("stream b: got %v, want %v", gotB.prevs, wantB.prevs)
+	}
+}